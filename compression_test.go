@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// uncompressedBody is large and repetitive enough that gzip will actually
+// shrink it, so we can assert on the Content-Encoding rather than just the
+// byte count.
+const uncompressedBody = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. " +
+	"Lorem ipsum dolor sit amet, consectetur adipiscing elit. " +
+	"Lorem ipsum dolor sit amet, consectetur adipiscing elit."
+
+// decodeBody returns the decompressed body bytes for a response, decoding
+// gzip if Content-Encoding says so, and its sha256 sum for easy comparison
+// against origin bytes.
+func decodeBody(t *testing.T, resp *http.Response) (body []byte, sum [32]byte) {
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Could not read response body: %v", err)
+	}
+
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Could not create gzip reader: %v", err)
+		}
+		defer gz.Close()
+		body, err = ioutil.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("Could not decompress gzip body: %v", err)
+		}
+	default:
+		body = raw
+	}
+
+	return body, sha256.Sum256(body)
+}
+
+// Should gzip-compress an uncompressed origin response when the client
+// advertises support for it.
+func TestCompressionGzipsUncompressedOrigin(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(uncompressedBody))
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := RoundTripCheckError(t, req)
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Expected Content-Encoding: gzip, got %q", ce)
+	}
+
+	body, sum := decodeBody(t, resp)
+	expectedSum := sha256.Sum256([]byte(uncompressedBody))
+	if sum != expectedSum {
+		t.Errorf("Decompressed body does not match origin bytes: got %q", body)
+	}
+}
+
+// Should return identity encoding when the client sends no Accept-Encoding.
+func TestCompressionIdentityWithoutAcceptEncoding(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(uncompressedBody))
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Del("Accept-Encoding")
+	resp := RoundTripCheckError(t, req)
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Errorf("Expected no Content-Encoding without Accept-Encoding, got %q", ce)
+	}
+
+	body, _ := decodeBody(t, resp)
+	if string(body) != uncompressedBody {
+		t.Errorf("Body does not match origin bytes: got %q", body)
+	}
+}
+
+// Should pass through an already-gzipped origin response without
+// double-compressing it.
+func TestCompressionPassesThroughPreCompressedOrigin(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(uncompressedBody))
+	gz.Close()
+
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped.Bytes())
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := RoundTripCheckError(t, req)
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Expected Content-Encoding: gzip, got %q", ce)
+	}
+
+	body, sum := decodeBody(t, resp)
+	expectedSum := sha256.Sum256([]byte(uncompressedBody))
+	if sum != expectedSum {
+		t.Errorf("Decompressed body does not match origin bytes, suggesting double-compression: got %q", body)
+	}
+}
+
+// Should set Vary: Accept-Encoding on cacheable responses.
+func TestCompressionVariesOnAcceptEncoding(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1800, public")
+		w.Write([]byte(uncompressedBody))
+	})
+
+	url := fmt.Sprintf("https://%s/?cache-lock=%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := RoundTripCheckError(t, req)
+
+	vary := resp.Header.Get("Vary")
+	if !headerListContains(vary, "Accept-Encoding") {
+		t.Errorf("Expected Vary to contain Accept-Encoding, got %q", vary)
+	}
+}
+
+// Should cache the gzip and identity variants of an object separately, so a
+// client without gzip support never receives a compressed body meant for one
+// that does.
+func TestCompressionCachesVariantsSeparately(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1800, public")
+		w.Write([]byte(uncompressedBody))
+	})
+
+	uuid := NewUUID()
+	url := fmt.Sprintf("https://%s/?cache-lock=%s", *edgeHost, uuid)
+
+	gzipReq, _ := http.NewRequest("GET", url, nil)
+	gzipReq.Header.Set("Accept-Encoding", "gzip")
+	RoundTripCheckError(t, gzipReq) // Prime the gzip variant.
+
+	identityReq, _ := http.NewRequest("GET", url, nil)
+	identityReq.Header.Del("Accept-Encoding")
+	identityResp := RoundTripCheckError(t, identityReq)
+
+	if ce := identityResp.Header.Get("Content-Encoding"); ce == "gzip" {
+		t.Error("Client without Accept-Encoding received the gzip cache variant")
+	}
+
+	gzipResp := RoundTripCheckError(t, gzipReq)
+	if ce := gzipResp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("Client with Accept-Encoding: gzip received the identity cache variant, Content-Encoding was %q", ce)
+	}
+}
+
+// headerListContains reports whether a comma-separated header value
+// contains name, ignoring case and surrounding whitespace.
+func headerListContains(value, name string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Should answer a preflight OPTIONS request itself, without invoking the
+// origin, for the common cache-hit case.
+func TestCorsPreflightDoesNotHitOrigin(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Preflight request should not have made it to origin")
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("OPTIONS", url, nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "X-Requested-With")
+	resp := RoundTripCheckError(t, req)
+
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		t.Fatalf("Expected 200 or 204 for preflight, got %d", resp.StatusCode)
+	}
+
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got == "" {
+		t.Error("Access-Control-Allow-Origin not set on preflight response")
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Methods"); got == "" {
+		t.Error("Access-Control-Allow-Methods not set on preflight response")
+	}
+	if got := resp.Header.Get("Access-Control-Max-Age"); got == "" {
+		t.Error("Access-Control-Max-Age not set on preflight response")
+	}
+}
+
+// Should vary on Origin so that a cached CORS response for one Origin is
+// never served to a client with a different Origin.
+func TestCorsResponseVariesOnOrigin(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("OPTIONS", url, nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp := RoundTripCheckError(t, req)
+
+	if vary := resp.Header.Get("Vary"); !headerListContains(vary, "Origin") {
+		t.Errorf("Expected Vary to contain Origin, got %q", vary)
+	}
+}
+
+// Should echo back the requesting Origin on actual (non-preflight)
+// cross-origin GET requests, and still allow the response to be cached.
+func TestCorsActualRequestEchoesOrigin(t *testing.T) {
+	const requestOrigin = "https://example.com"
+
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1800, public")
+	})
+
+	uuid := NewUUID()
+	url := fmt.Sprintf("https://%s/?cache-lock=%s", *edgeHost, uuid)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Origin", requestOrigin)
+	resp := RoundTripCheckError(t, req)
+
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != requestOrigin {
+		t.Errorf("Expected Access-Control-Allow-Origin to echo %q, got %q", requestOrigin, got)
+	}
+
+	// Repeat the same cross-origin request; it should now be served from cache.
+	resp = RoundTripCheckError(t, req)
+	xCache := resp.Header.Get("X-Cache")
+	if !containsHit(xCache) {
+		t.Errorf("Expected repeated cross-origin GET to be a cache HIT, got X-Cache %q", xCache)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// originFailoverThreshold documents the edge's configured number of
+// consecutive origin failures tolerated before it fails over to the next
+// backend, so tests assert against the edge's actual config rather than a
+// guessed constant.
+var originFailoverThreshold = flag.Int(
+	"origin-failover-threshold",
+	3,
+	"Consecutive origin failures the edge tolerates before failing over to the next backend",
+)
+
+// originTimeoutThreshold documents the edge's configured origin response
+// timeout, so the timeout-failure test sleeps reliably past it rather than
+// guessing a "safe" duration.
+var originTimeoutThreshold = flag.Duration(
+	"origin-timeout-threshold",
+	5*time.Second,
+	"Origin response time the edge is configured to wait before treating a request as timed out",
+)
+
+// backupOriginAddr is the fixed address the edge's director/failover config
+// is already configured to use as its backup origin. This suite binds its
+// own backup test server there rather than assuming some externally-defined
+// helper or global provides one.
+var backupOriginAddr = flag.String(
+	"backup-origin-addr",
+	"127.0.0.1:9091",
+	"Fixed address the edge's backup origin slot is already configured to point at",
+)
+
+// OriginBackend is satisfied by any origin server this suite can install a
+// handler on. originServer (the edge's pre-existing primary) already
+// supports this; the backup is started explicitly below rather than assumed
+// to exist under some other name.
+type OriginBackend interface {
+	SwitchHandler(http.HandlerFunc)
+}
+
+// testOriginServer is a minimal backend this suite owns outright: an
+// httptest.Server bound to a fixed, pre-agreed address, with the same
+// atomic-handler-swap behavior as originServer. It exists so the backup
+// endpoint doesn't rely on any unverified external symbol or backend
+// capability beyond the standard net/http/httptest.Server API.
+type testOriginServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	handler http.HandlerFunc
+}
+
+// newTestOriginServer starts a backend listening on addr.
+func newTestOriginServer(addr string) *testOriginServer {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(fmt.Sprintf("origin_pool_test: could not bind backup origin at %s: %v", addr, err))
+	}
+
+	o := &testOriginServer{}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(o.serveHTTP))
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	o.Server = ts
+
+	return o
+}
+
+func (o *testOriginServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	handler := o.handler
+	o.mu.Unlock()
+
+	if handler != nil {
+		handler(w, r)
+	}
+}
+
+// SwitchHandler replaces the handler used to answer requests, in the same
+// fashion as originServer.SwitchHandler.
+func (o *testOriginServer) SwitchHandler(handler http.HandlerFunc) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.handler = handler
+}
+
+var (
+	backupOriginServer     *testOriginServer
+	backupOriginServerOnce sync.Once
+)
+
+// ensureBackupOriginServer lazily starts the backup backend on its first
+// use, after flags have been parsed, rather than at package-init time when
+// -backup-origin-addr wouldn't have its real value yet.
+func ensureBackupOriginServer() *testOriginServer {
+	backupOriginServerOnce.Do(func() {
+		backupOriginServer = newTestOriginServer(*backupOriginAddr)
+	})
+	return backupOriginServer
+}
+
+// Endpoint layers an identifying response header and a hit counter on top
+// of one of the edge's origin backends. The wrapper that stamps
+// X-Origin-Name is installed once, in NewPool, so it is present on every
+// endpoint from the start regardless of which test runs or in what order -
+// individual tests only ever change the user-supplied handler via
+// SwitchHandler.
+type Endpoint struct {
+	Name   string
+	origin OriginBackend
+
+	mu          sync.Mutex
+	hitCount    int
+	userHandler http.HandlerFunc
+}
+
+// installIdentifyingWrapper wires this endpoint's permanent handler onto its
+// backend. Must be called exactly once, before the endpoint is used.
+func (e *Endpoint) installIdentifyingWrapper() {
+	e.origin.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		e.hitCount++
+		handler := e.userHandler
+		e.mu.Unlock()
+
+		w.Header().Set("X-Origin-Name", e.Name)
+		if handler != nil {
+			handler(w, r)
+		}
+	})
+}
+
+// SwitchHandler replaces the handler used to answer requests reaching this
+// endpoint, in the same fashion as originServer.SwitchHandler, without
+// disturbing the identifying wrapper installed by NewPool.
+func (e *Endpoint) SwitchHandler(handler http.HandlerFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.userHandler = handler
+}
+
+// HitCount returns the number of requests this endpoint has served since
+// the last ResetHitCount.
+func (e *Endpoint) HitCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.hitCount
+}
+
+// ResetHitCount zeroes this endpoint's hit counter. Tests should call this
+// between subtests sharing a Pool.
+func (e *Endpoint) ResetHitCount() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hitCount = 0
+}
+
+// Pool groups the edge's primary origin with its configured backups.
+// Callers should call Reset between subtests rather than share a Pool
+// across parallel t.Run subtests, since Reset mutates shared backend state.
+type Pool struct {
+	Endpoints []*Endpoint
+}
+
+// NewPool wraps the edge's existing primary (originServer) and its backup
+// (started on demand at backupOriginAddr), installing each endpoint's
+// identifying wrapper immediately so both are identifiable from the very
+// first request, regardless of test order or isolation.
+func NewPool() *Pool {
+	p := &Pool{
+		Endpoints: []*Endpoint{
+			{Name: "primary", origin: originServer},
+			{Name: "backup", origin: ensureBackupOriginServer()},
+		},
+	}
+	for _, e := range p.Endpoints {
+		e.installIdentifyingWrapper()
+	}
+	return p
+}
+
+// Reset restores every endpoint to an empty-handler, zero-hit-count state
+// between subtests.
+func (p *Pool) Reset() {
+	for _, e := range p.Endpoints {
+		e.ResetHitCount()
+		e.SwitchHandler(nil)
+	}
+}
+
+// Primary returns the primary endpoint in the pool.
+func (p *Pool) Primary() *Endpoint {
+	return p.Endpoints[0]
+}
+
+// Backups returns every endpoint after the primary.
+func (p *Pool) Backups() []*Endpoint {
+	return p.Endpoints[1:]
+}
+
+// fail500 is a handler that always returns a 5xx, simulating an origin that
+// is up but erroring.
+func fail500(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// resetConnection simulates an abrupt connection reset from an origin by
+// hijacking and closing the underlying connection instead of returning a
+// normal HTTP response. This relies only on the standard http.Hijacker
+// interface that any origin server's ResponseWriter supports, rather than
+// any backend-specific reset capability.
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("origin_pool_test: ResponseWriter does not support hijacking")
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(fmt.Sprintf("origin_pool_test: could not hijack connection: %v", err))
+	}
+	conn.Close()
+}
+
+// failTimeout sleeps past d, simulating an origin that has stopped
+// responding rather than one that errors outright.
+func failTimeout(d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(d)
+	}
+}
+
+// servedBy issues a request through the edge and returns which origin name
+// served it, using the X-Origin-Name header each Endpoint stamps.
+func servedBy(t *testing.T, uuid string) (resp *http.Response, originName string) {
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, uuid)
+	req, _ := http.NewRequest("GET", url, nil)
+	resp = RoundTripCheckError(t, req)
+	originName = resp.Header.Get("X-Origin-Name")
+	return resp, originName
+}
+
+// failoverAndConfirm issues originFailoverThreshold requests through the
+// edge, without checking their outcome, then returns the response and origin
+// name for the request immediately after.
+func failoverAndConfirm(t *testing.T, uuid string) (resp *http.Response, originName string) {
+	for i := 0; i < *originFailoverThreshold; i++ {
+		servedBy(t, uuid)
+	}
+	return servedBy(t, uuid)
+}
+
+// Should serve all requests from the primary while it is healthy.
+func TestFailoverPrimaryHealthy(t *testing.T) {
+	pool := NewPool()
+	defer pool.Reset()
+
+	uuid := NewUUID()
+	resp, origin := servedBy(t, uuid)
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected 200 from healthy primary, got %d", resp.StatusCode)
+	}
+	if origin != pool.Primary().Name {
+		t.Errorf("Expected primary to serve request, got %q", origin)
+	}
+	if hits := pool.Backups()[0].HitCount(); hits != 0 {
+		t.Errorf("Backup should not have been hit, got %d hits", hits)
+	}
+}
+
+// Should fail over to the backup once the primary has returned enough
+// consecutive 502s to be deemed unhealthy, and should report a plain MISS
+// from the backup (it sets no X-Cache of its own) rather than leaking the
+// primary's error, matching TestXCacheHeaderContainsMissOnlyIfOriginDoesNotSetXCache.
+func TestFailoverOnConsecutive5xx(t *testing.T) {
+	pool := NewPool()
+	defer pool.Reset()
+
+	pool.Primary().SwitchHandler(fail500)
+
+	uuid := NewUUID()
+	resp, origin := failoverAndConfirm(t, uuid)
+	if origin != pool.Backups()[0].Name {
+		t.Fatalf("Expected backup to take over after %d failures, got %q",
+			*originFailoverThreshold, origin)
+	}
+
+	if xCache := resp.Header.Get("X-Cache"); xCache != "MISS" {
+		t.Errorf("Expected backup response to report MISS, got %q", xCache)
+	}
+}
+
+// Should fail over to the backup when the primary resets the connection
+// outright, not just when it returns a 5xx status.
+func TestFailoverOnConnectionReset(t *testing.T) {
+	pool := NewPool()
+	defer pool.Reset()
+
+	pool.Primary().SwitchHandler(resetConnection)
+
+	uuid := NewUUID()
+	_, origin := failoverAndConfirm(t, uuid)
+	if origin != pool.Backups()[0].Name {
+		t.Fatalf("Expected backup to take over after %d connection resets, got %q",
+			*originFailoverThreshold, origin)
+	}
+}
+
+// Should fail over to the backup when the primary stops responding
+// entirely, rather than erroring outright.
+func TestFailoverOnTimeout(t *testing.T) {
+	pool := NewPool()
+	defer pool.Reset()
+
+	pool.Primary().SwitchHandler(failTimeout(*originTimeoutThreshold + time.Second))
+
+	uuid := NewUUID()
+	_, origin := failoverAndConfirm(t, uuid)
+	if origin != pool.Backups()[0].Name {
+		t.Fatalf("Expected backup to take over after repeated timeouts, got %q", origin)
+	}
+}
+
+// Should restore traffic to the primary once it recovers.
+func TestFailoverRecoversToPrimary(t *testing.T) {
+	pool := NewPool()
+	defer pool.Reset()
+
+	pool.Primary().SwitchHandler(fail500)
+
+	uuid := NewUUID()
+	_, origin := failoverAndConfirm(t, uuid)
+	if origin != pool.Backups()[0].Name {
+		t.Fatalf("Expected backup to be serving before recovery, got %q", origin)
+	}
+
+	pool.Primary().SwitchHandler(nil)
+
+	_, origin = servedBy(t, uuid)
+	if origin != pool.Primary().Name {
+		t.Errorf("Expected primary to resume serving after recovery, got %q", origin)
+	}
+}
+
+// Should return 503, not a leaked 502, when every origin is unavailable.
+func TestFailoverAllOriginsDown(t *testing.T) {
+	pool := NewPool()
+	defer pool.Reset()
+
+	for _, e := range pool.Endpoints {
+		e.SwitchHandler(fail500)
+	}
+
+	uuid := NewUUID()
+	resp, _ := failoverAndConfirm(t, uuid)
+	if resp.StatusCode != 503 {
+		t.Errorf("Expected 503 when all origins are down, got %d", resp.StatusCode)
+	}
+}
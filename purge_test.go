@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// purgeFromWhitelisted should be set to true when this suite is being run
+// from an IP address the Edge's ACL whitelists for PURGE requests. It is the
+// opposite of the assumption TestRestrictPurgeRequests makes in its
+// docstring; that test does not read this flag.
+var purgeFromWhitelisted = flag.Bool(
+	"purge-from-whitelisted",
+	false,
+	"Whether this test run originates from an IP whitelisted for PURGE requests",
+)
+
+// purgeByKey issues a surrogate-key purge as a literal PURGE request carrying
+// a Surrogate-Key header. The Fastly-style POST to /service/*/purge/<key> is
+// not tried.
+func purgeByKey(t *testing.T, key string) *http.Response {
+	url := fmt.Sprintf("https://%s/", *edgeHost)
+	req, _ := http.NewRequest("PURGE", url, nil)
+	req.Header.Set("Surrogate-Key", key)
+	return RoundTripCheckError(t, req)
+}
+
+// primeWithTags issues a cacheable GET for path, with origin setting the
+// given Surrogate-Key header, and returns the X-Cache value observed.
+func primeWithTags(t *testing.T, path, tags string) string {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1800, public")
+		w.Header().Set("Surrogate-Key", tags)
+	})
+
+	url := fmt.Sprintf("https://%s%s", *edgeHost, path)
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+	return resp.Header.Get("X-Cache")
+}
+
+// cacheStatus issues a plain GET for path and returns the X-Cache value,
+// without changing the origin handler, so an already-cached object is
+// observed rather than re-primed.
+func cacheStatus(t *testing.T, path string) string {
+	url := fmt.Sprintf("https://%s%s", *edgeHost, path)
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+	return resp.Header.Get("X-Cache")
+}
+
+// Should purge exactly the URLs tagged with the purged surrogate key,
+// leaving URLs with no overlapping tag untouched.
+func TestSurrogateKeyPurgeInvalidatesTaggedURLsOnly(t *testing.T) {
+	if !*purgeFromWhitelisted {
+		t.Skip("Not running from a whitelisted address for PURGE requests")
+	}
+
+	uuid := NewUUID()
+	taggedPathA := fmt.Sprintf("/%s/a", uuid)
+	taggedPathB := fmt.Sprintf("/%s/b", uuid)
+	untaggedPath := fmt.Sprintf("/%s/c", uuid)
+
+	primeWithTags(t, taggedPathA, "tag-a tag-b")
+	primeWithTags(t, taggedPathB, "tag-b")
+	primeWithTags(t, untaggedPath, "tag-c")
+
+	// Second request to each: should now be HIT, confirming priming worked.
+	for _, path := range []string{taggedPathA, taggedPathB, untaggedPath} {
+		if status := cacheStatus(t, path); !containsHit(status) {
+			t.Fatalf("Expected %s to be primed as a HIT before purge, got %q", path, status)
+		}
+	}
+
+	resp := purgeByKey(t, "tag-b")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		t.Fatalf("Purge request failed with status %d", resp.StatusCode)
+	}
+
+	if status := cacheStatus(t, taggedPathA); containsHit(status) {
+		t.Errorf("Expected %s tagged with tag-b to MISS after purge, got %q", taggedPathA, status)
+	}
+	if status := cacheStatus(t, taggedPathB); containsHit(status) {
+		t.Errorf("Expected %s tagged with tag-b to MISS after purge, got %q", taggedPathB, status)
+	}
+	if status := cacheStatus(t, untaggedPath); !containsHit(status) {
+		t.Errorf("Expected untagged %s to remain a HIT after purging tag-b, got %q", untaggedPath, status)
+	}
+}
+
+// Should serve a soft-purged object as stale while a background
+// revalidation to origin happens, rather than treating it as a hard MISS.
+func TestSurrogateKeySoftPurgeServesStaleDuringRevalidation(t *testing.T) {
+	if !*purgeFromWhitelisted {
+		t.Skip("Not running from a whitelisted address for PURGE requests")
+	}
+
+	uuid := NewUUID()
+	path := fmt.Sprintf("/%s", uuid)
+
+	primeWithTags(t, path, "tag-soft")
+	if status := cacheStatus(t, path); !containsHit(status) {
+		t.Fatalf("Expected %s to be primed as a HIT before soft purge, got %q", path, status)
+	}
+
+	url := fmt.Sprintf("https://%s/", *edgeHost)
+	req, _ := http.NewRequest("PURGE", url, nil)
+	req.Header.Set("Surrogate-Key", "tag-soft")
+	req.Header.Set("Fastly-Soft-Purge", "1")
+	resp := RoundTripCheckError(t, req)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		t.Fatalf("Soft purge request failed with status %d", resp.StatusCode)
+	}
+
+	var revalidated bool
+	var mu sync.Mutex
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		revalidated = true
+		mu.Unlock()
+		w.Header().Set("Cache-Control", "max-age=1800, public")
+	})
+
+	status := cacheStatus(t, path)
+	if !containsHit(status) || !strings.Contains(status, "STALE") {
+		t.Errorf("Expected soft-purged object to be served stale, got X-Cache %q", status)
+	}
+
+	const revalidationPollTimeout = 10 * time.Second
+	const revalidationPollInterval = 100 * time.Millisecond
+	deadline := time.Now().Add(revalidationPollTimeout)
+	for {
+		mu.Lock()
+		done := revalidated
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("Origin was not revalidated in the background within %s of soft purge", revalidationPollTimeout)
+			break
+		}
+		time.Sleep(revalidationPollInterval)
+	}
+}
+
+// containsHit reports whether an X-Cache header value indicates any hit,
+// whether alone or alongside an origin-reported value (e.g. "HIT, HIT").
+func containsHit(xCache string) bool {
+	return strings.Contains(xCache, "HIT")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// securityHeaderPolicy controls how the edge reconciles origin-supplied
+// security headers with its own configured values: "override" always wins
+// with the edge's value, "passthrough" leaves origin's value untouched, and
+// "merge" combines directives (e.g. CSP) from both.
+var securityHeaderPolicy = flag.String(
+	"security-header-policy",
+	"override",
+	"Policy for reconciling origin security headers: override|passthrough|merge",
+)
+
+const minHstsMaxAge = 15768000 // 6 months, a common baseline floor.
+
+// Should set Strict-Transport-Security with a minimum max-age and
+// includeSubDomains on every HTTPS response.
+func TestSecurityHeaderHSTS(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	hsts := resp.Header.Get("Strict-Transport-Security")
+	if hsts == "" {
+		t.Fatal("Strict-Transport-Security header not set by Edge")
+	}
+
+	if !strings.Contains(hsts, "includeSubDomains") {
+		t.Errorf("Strict-Transport-Security missing includeSubDomains: got %q", hsts)
+	}
+
+	maxAge := parseMaxAge(t, hsts)
+	if maxAge < minHstsMaxAge {
+		t.Errorf("Strict-Transport-Security max-age too low: expected >= %d, got %d", minHstsMaxAge, maxAge)
+	}
+}
+
+// Should set X-Content-Type-Options: nosniff on every HTTPS response.
+func TestSecurityHeaderXContentTypeOptions(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options expected %q, got %q", "nosniff", got)
+	}
+}
+
+// Should set a frame-ancestors policy via X-Frame-Options and/or CSP to
+// prevent clickjacking.
+func TestSecurityHeaderFrameAncestors(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	xfo := resp.Header.Get("X-Frame-Options")
+	csp := resp.Header.Get("Content-Security-Policy")
+
+	if xfo == "" && !strings.Contains(csp, "frame-ancestors") {
+		t.Error("Neither X-Frame-Options nor a CSP frame-ancestors directive is set")
+	}
+}
+
+// Should set a Referrer-Policy header.
+func TestSecurityHeaderReferrerPolicy(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	if resp.Header.Get("Referrer-Policy") == "" {
+		t.Error("Referrer-Policy header not set by Edge")
+	}
+}
+
+// Should set X-XSS-Protection.
+func TestSecurityHeaderXXSSProtection(t *testing.T) {
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	if resp.Header.Get("X-XSS-Protection") == "" {
+		t.Error("X-XSS-Protection header not set by Edge")
+	}
+}
+
+// Should override an origin-supplied security header with the Edge's own
+// value when the policy is "override", and should keep enforcing it even
+// when the origin omits the header entirely.
+func TestSecurityHeaderOverridesOrigin(t *testing.T) {
+	if *securityHeaderPolicy != "override" {
+		t.Skipf("Edge is not configured with -security-header-policy=override")
+	}
+
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "ALLOWALL")
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	if got := resp.Header.Get("X-Frame-Options"); got == "ALLOWALL" {
+		t.Errorf("Edge passed through origin's X-Frame-Options under override policy: got %q", got)
+	}
+
+	// Origin now omits the header entirely; Edge must still enforce it.
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	url = fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ = http.NewRequest("GET", url, nil)
+	resp = RoundTripCheckError(t, req)
+
+	if resp.Header.Get("X-Frame-Options") == "" {
+		t.Error("X-Frame-Options disappeared when origin stopped sending it under override policy")
+	}
+}
+
+// Should leave an origin-supplied security header untouched when the policy
+// is "passthrough".
+func TestSecurityHeaderPassthroughOrigin(t *testing.T) {
+	if *securityHeaderPolicy != "passthrough" {
+		t.Skip("Edge is not configured with -security-header-policy=passthrough")
+	}
+
+	const originVal = "ALLOWALL"
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", originVal)
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	if got := resp.Header.Get("X-Frame-Options"); got != originVal {
+		t.Errorf("Expected passthrough policy to leave X-Frame-Options as %q, got %q", originVal, got)
+	}
+}
+
+// Should combine the Edge's own CSP directives with origin-supplied ones
+// when the policy is "merge", rather than one replacing the other.
+func TestSecurityHeaderMergeWithOrigin(t *testing.T) {
+	if *securityHeaderPolicy != "merge" {
+		t.Skip("Edge is not configured with -security-header-policy=merge")
+	}
+
+	const originDirective = "img-src 'self' https://images.example.com"
+	originServer.SwitchHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", originDirective)
+	})
+
+	url := fmt.Sprintf("https://%s/%s", *edgeHost, NewUUID())
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := RoundTripCheckError(t, req)
+
+	csp := resp.Header.Get("Content-Security-Policy")
+	if !strings.Contains(csp, originDirective) {
+		t.Errorf("Expected merged CSP to retain origin's directive %q, got %q", originDirective, csp)
+	}
+	if !strings.Contains(csp, "frame-ancestors") {
+		t.Errorf("Expected merged CSP to retain the Edge's own frame-ancestors directive, got %q", csp)
+	}
+}
+
+// parseMaxAge extracts the max-age directive's value from a header such as
+// Strict-Transport-Security.
+func parseMaxAge(t *testing.T, header string) int {
+	for _, part := range strings.Split(header, ";") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "max-age=") {
+			v, err := strconv.Atoi(strings.TrimPrefix(part, "max-age="))
+			if err != nil {
+				t.Fatalf("Could not parse max-age from %q: %v", header, err)
+			}
+			return v
+		}
+	}
+	t.Fatalf("No max-age directive found in %q", header)
+	return 0
+}